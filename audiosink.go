@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// audioSink is the original Sink: it turns each Voice into a tone via its own
+// spectralSynth and mixes them into a stereo PortAudio stream, panned per
+// Voice.Pan.
+type audioSink struct {
+	outputDevice *portaudio.DeviceInfo
+	counter      int
+
+	// synths holds one spectralSynth per Voice.ID, created the first time a
+	// given ID is seen so each voice keeps its own phase continuity. Growing
+	// this map only happens when a new source ID first appears, not on every
+	// buffer.
+	synths map[byte]*spectralSynth
+	// scratch is the mono buffer each voice is synthesized into before being
+	// panned and mixed into the stereo output.
+	scratch [fftN]float32
+
+	// voicesMu guards voices. Unlike the benign races this codebase tolerates
+	// on primitive fields (e.g. percentileRing.data), a slice header is
+	// multiple words, so an unsynchronized write racing render's read could
+	// hand it a torn header (a stale pointer paired with a new length) rather
+	// than just a stale value. render is invoked on PortAudio's own thread via
+	// cgo, genuinely concurrently with whatever goroutine calls Play, so this
+	// needs a real lock.
+	voicesMu sync.Mutex
+	// voices is the latest snapshot handed to Play; render (the PortAudio
+	// callback) reads it each buffer.
+	voices []Voice
+
+	// rec is the tap StartRecording installs into render. Left nil until
+	// StartRecording is called, so recording is entirely opt-in.
+	rec *recorder
+	// recordFormat is the encoding StartRecording will use; set it via
+	// SetRecordFormat before calling StartRecording.
+	recordFormat RecordFormat
+}
+
+// newAudioSink creates a Sink that plays through device, selected by name
+// (substring match) or index; an empty string uses the portaudio default
+// output device.
+func newAudioSink(device string) (*audioSink, error) {
+	if err := portaudio.Initialize(); err != nil {
+		return nil, err
+	}
+	outputDevice, err := findOutputDevice(device)
+	if err != nil {
+		return nil, err
+	}
+	return &audioSink{outputDevice: outputDevice, synths: make(map[byte]*spectralSynth)}, nil
+}
+
+// ListDevices returns every input/output device known to portaudio, across
+// all host APIs, in enumeration order.
+func ListDevices() ([]*portaudio.DeviceInfo, error) {
+	hostApis, err := portaudio.HostApis()
+	if err != nil {
+		return nil, err
+	}
+	var devices []*portaudio.DeviceInfo
+	for _, api := range hostApis {
+		devices = append(devices, api.Devices...)
+	}
+	return devices, nil
+}
+
+// findOutputDevice resolves spec (an empty string, a device index, or a
+// case-insensitive substring of a device name) to an output-capable device.
+// An empty spec returns the portaudio default output device.
+func findOutputDevice(spec string) (*portaudio.DeviceInfo, error) {
+	if spec == "" {
+		return portaudio.DefaultOutputDevice()
+	}
+	devices, err := ListDevices()
+	if err != nil {
+		return nil, err
+	}
+	if idx, err := strconv.Atoi(spec); err == nil {
+		for _, d := range devices {
+			if d.Index == idx && d.MaxOutputChannels > 0 {
+				return d, nil
+			}
+		}
+		return nil, fmt.Errorf("no output device with index %d", idx)
+	}
+	lower := strings.ToLower(spec)
+	for _, d := range devices {
+		if d.MaxOutputChannels > 0 && strings.Contains(strings.ToLower(d.Name), lower) {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("no output device matching %q", spec)
+}
+
+// SetRecordFormat sets the sample encoding the next StartRecording call will
+// use. It has no effect once recording has started.
+func (a *audioSink) SetRecordFormat(format RecordFormat) {
+	a.recordFormat = format
+}
+
+// StartRecording writes the mixed stereo output render produces to a WAV
+// file at path, in the format set by SetRecordFormat (Int16Format by
+// default). The tap installed in render only ever copies into a ring buffer,
+// so this never adds GC or disk I/O to the audio callback; a background
+// goroutine drains the ring and does the actual encoding and file I/O.
+func (a *audioSink) StartRecording(path string) {
+	w, err := createWavWriter(path, a.recordFormat)
+	if err != nil {
+		fmt.Printf("Failed to start recording %v\n", err)
+		return
+	}
+	a.rec = &recorder{quit: make(chan struct{}), done: make(chan struct{})}
+	go a.rec.drain(w)
+}
+
+// Play stores voices for render to pick up on the next buffer.
+func (a *audioSink) Play(voices []Voice) {
+	a.voicesMu.Lock()
+	a.voices = voices
+	a.voicesMu.Unlock()
+}
+
+// equalPowerPan turns a pan value (-1 left .. 1 right) into per-channel
+// gains that keep total power constant across the stereo field.
+func equalPowerPan(pan float64) (left, right float32) {
+	theta := (pan + 1) * math.Pi / 4
+	return float32(math.Cos(theta)), float32(math.Sin(theta))
+}
+
+// render is called by PortAudio once per audio buffer. out is interleaved
+// stereo (out[2*i], out[2*i+1] are the left/right samples for frame i) and
+// must have length 2*fftN, which is what Start asks portaudio for.
+func (a *audioSink) render(out []float32) {
+	for i := range out {
+		out[i] = 0
+	}
+
+	a.voicesMu.Lock()
+	voices := a.voices
+	a.voicesMu.Unlock()
+	ampClamp := getAmpClamp()
+
+	var loggedBaseFreq bool
+	for _, v := range voices {
+		synth, ok := a.synths[v.ID]
+		if !ok {
+			synth = newSpectralSynth()
+			a.synths[v.ID] = synth
+		}
+		synth.reset()
+
+		baseStep := convertLatencyToStep(v.Percentiles[0])
+		prevP := 0.0
+
+		// Deposit each harmonic into the frequency domain (see fourier
+		// transform) instead of summing sines sample by sample.
+		for i, p := range v.Percentiles {
+			// We want all waves to have the same "period" which is computed by the P50 value.
+			// step is a multiple of the base rate, each step is half the previous step.
+			// higher P values have higher frequency steps.
+			step := baseStep * multipliers[i]
+
+			// amp is the height of the sine curve which is based on ratio from
+			// adjacent step. Start with amp 1 for the base, and increase for the
+			// others. Don't allow any individual amp to get above ampClamp-1
+			// (2.0 with the default ampClamp; your ears will thank me).
+			amp := math.Min(float64(p)/prevP, ampClamp) - 1
+			prevP = float64(p)
+			synth.deposit(i, step, amp)
+		}
+
+		// Turn this voice's frequency-domain buffer into samples via an
+		// inverse FFT, then pan and mix them into the stereo output.
+		synth.generate(a.scratch[:])
+		left, right := equalPowerPan(v.Pan)
+		for i, s := range a.scratch {
+			out[2*i] += s * left
+			out[2*i+1] += s * right
+		}
+
+		// Periodically print this. Could change to time based instead.
+		if a.counter%1000 == 0 && !loggedBaseFreq {
+			fmt.Println("Base freq: ", int(baseStep*rate))
+			loggedBaseFreq = true
+		}
+	}
+
+	// Tap the exact samples PortAudio is about to consume for StartRecording.
+	// This only ever touches the ring buffer, never disk, so it can't block
+	// the callback.
+	if a.rec != nil {
+		a.rec.write(out)
+	}
+	a.counter++
+}
+
+// Start opens the stereo PortAudio stream and begins rendering.
+func (a *audioSink) Start() error {
+	params := portaudio.StreamParameters{
+		Output: portaudio.StreamDeviceParameters{
+			Device:   a.outputDevice,
+			Channels: 2,
+			Latency:  a.outputDevice.DefaultLowOutputLatency,
+		},
+		SampleRate:      rate,
+		FramesPerBuffer: fftN,
+	}
+	stream, err := portaudio.OpenStream(params, a.render)
+	if err != nil {
+		return err
+	}
+	return stream.Start()
+}
+
+// Stop the portaudio device and any in-progress recording.
+func (a *audioSink) Stop() {
+	if a.rec != nil {
+		close(a.rec.quit)
+		<-a.rec.done
+	}
+	_ = portaudio.Terminate()
+}
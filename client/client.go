@@ -0,0 +1,67 @@
+// Package client lets other services emit latency samples to the latency
+// tool over UDP, in either the legacy fixed-size format or the newer framed
+// one (so a single value can carry a timestamp and a label).
+package client
+
+import (
+	"net"
+
+	"github.com/andrewbaptist/latency/wire"
+)
+
+// Client sends latency samples for a single source ID to a listening
+// latency tool.
+type Client struct {
+	conn *net.UDPConn
+	id   byte
+}
+
+// New creates a Client that will tag every sample it sends with id and send
+// them to addr (e.g. "127.0.0.1:12345").
+func New(addr string, id byte) (*Client, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, id: id}, nil
+}
+
+// Send emits a sample in the original legacy format: a uint32 microsecond
+// value followed by the source ID byte. Use this if the listener on the
+// other end might be an older build that doesn't understand framed packets.
+func (c *Client) Send(valueUs uint32) error {
+	buf := make([]byte, wire.LegacyPacketSize)
+	buf[0] = byte(valueUs)
+	buf[1] = byte(valueUs >> 8)
+	buf[2] = byte(valueUs >> 16)
+	buf[3] = byte(valueUs >> 24)
+	buf[4] = c.id
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+// SendLabeled emits a sample in the framed format, carrying a timestamp and
+// a human-readable label (e.g. "db", "cache", "rpc") so multiple
+// instrumented services can be told apart when played back.
+func (c *Client) SendLabeled(valueUs uint32, timestampUs uint64, label string) error {
+	buf, err := wire.EncodeFrame([]wire.Record{{
+		ID:          c.id,
+		TimestampUs: timestampUs,
+		ValueUs:     valueUs,
+		Label:       label,
+	}})
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(buf)
+	return err
+}
+
+// Close releases the underlying UDP socket.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
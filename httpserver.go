@@ -0,0 +1,151 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+//go:embed static
+var staticFiles embed.FS
+
+// socketHz is how often /socket pushes a new frame to connected dashboards.
+const socketHz = 30
+
+// httpServer is the opt-in control/observability plane enabled by --http in
+// main.go: Prometheus metrics at /metrics, a small JSON config API at
+// /api/config, a live WebSocket feed at /socket, and the bundled dashboard
+// that consumes it. This turns the tool from a black-box audio pipe into
+// something operators can introspect and reconfigure without restarting.
+type httpServer struct {
+	streamer *Streamer
+	server   *http.Server
+	upgrader websocket.Upgrader
+}
+
+// newHTTPServer builds an httpServer that will listen on addr once Start is
+// called.
+func newHTTPServer(addr string, s *Streamer) (*httpServer, error) {
+	static, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		return nil, err
+	}
+
+	h := &httpServer{streamer: s}
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(static)))
+	mux.HandleFunc("/metrics", h.handleMetrics)
+	mux.HandleFunc("/api/config", h.handleConfig)
+	mux.HandleFunc("/socket", h.handleSocket)
+	h.server = &http.Server{Addr: addr, Handler: mux}
+	return h, nil
+}
+
+// Start begins serving in the background.
+func (h *httpServer) Start() {
+	go func() {
+		if err := h.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fmt.Printf("http server stopped: %v\n", err)
+		}
+	}()
+}
+
+// Stop closes the listener and any open HTTP connections. /socket clients
+// are hijacked WebSocket connections, which http.Server.Close does not
+// close; their handleSocket loops keep running until a write fails.
+func (h *httpServer) Stop() {
+	_ = h.server.Close()
+}
+
+// handleMetrics renders the current percentiles, per-ID point counters, and
+// derived base frequency in Prometheus text format.
+func (h *httpServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	voices := h.streamer.Voices()
+
+	fmt.Fprintln(w, "# HELP latency_percentile_microseconds Percentile snapshot per source ID; bin 0 is the base (P50), bin 7 the highest percentile tracked.")
+	fmt.Fprintln(w, "# TYPE latency_percentile_microseconds gauge")
+	for _, v := range voices {
+		for bin, value := range v.Percentiles {
+			fmt.Fprintf(w, "latency_percentile_microseconds{id=\"%d\",bin=\"%d\"} %d\n", v.ID, bin, value)
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP latency_total_points_total Total points received per source ID.")
+	fmt.Fprintln(w, "# TYPE latency_total_points_total counter")
+	for _, v := range voices {
+		fmt.Fprintf(w, "latency_total_points_total{id=\"%d\"} %d\n", v.ID, h.streamer.TotalPoints(v.ID))
+	}
+
+	fmt.Fprintln(w, "# HELP latency_base_frequency_hz Base (P50-derived) tone frequency per source ID.")
+	fmt.Fprintln(w, "# TYPE latency_base_frequency_hz gauge")
+	for _, v := range voices {
+		baseStep := convertLatencyToStep(v.Percentiles[0])
+		fmt.Fprintf(w, "latency_base_frequency_hz{id=\"%d\"} %.1f\n", v.ID, baseStep*rate)
+	}
+}
+
+// handleConfig serves the current Config on GET and applies a partial update
+// on POST/PUT, per SetConfig's zero-value-means-unchanged rule.
+func (h *httpServer) handleConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		_ = json.NewEncoder(w).Encode(h.streamer.GetConfig())
+	case http.MethodPost, http.MethodPut:
+		var cfg Config
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.streamer.SetConfig(cfg)
+		_ = json.NewEncoder(w).Encode(h.streamer.GetConfig())
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// socketFrame is what /socket pushes to the dashboard, roughly socketHz
+// times a second.
+type socketFrame struct {
+	Voices []socketVoice `json:"voices"`
+}
+
+type socketVoice struct {
+	ID            byte       `json:"id"`
+	Pan           float64    `json:"pan"`
+	Percentiles   [8]uint32  `json:"percentiles"`
+	FrequenciesHz [8]float64 `json:"frequenciesHz"`
+}
+
+// handleSocket upgrades to a WebSocket and streams socketFrames until a
+// write to the client fails (e.g. the client disconnected). Stop does not
+// end this loop.
+func (h *httpServer) handleSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	ticker := time.NewTicker(time.Second / socketHz)
+	defer ticker.Stop()
+	for range ticker.C {
+		voices := h.streamer.Voices()
+		frame := socketFrame{Voices: make([]socketVoice, len(voices))}
+		for i, v := range voices {
+			baseStep := convertLatencyToStep(v.Percentiles[0])
+			var freqs [8]float64
+			for j := range v.Percentiles {
+				freqs[j] = baseStep * multipliers[j] * rate
+			}
+			frame.Voices[i] = socketVoice{ID: v.ID, Pan: v.Pan, Percentiles: v.Percentiles, FrequenciesHz: freqs}
+		}
+		if err := conn.WriteJSON(frame); err != nil {
+			return
+		}
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"encoding/binary"
 	"net"
+
+	"github.com/andrewbaptist/latency/wire"
 )
 
 type UDPListener struct {
@@ -10,28 +12,40 @@ type UDPListener struct {
 	quit chan struct{}
 }
 
-// Listen for data and calls the output func when it receives data until Stop is
-// called.
-func (l *UDPListener) Listen(output func(uint32, byte)) {
-	// Read incoming messages in a loop, allocate the buf only once.
-	buf := make([]byte, 5)
+// Listen for data and calls output for every record it receives until Stop
+// is called. Each datagram is either the legacy fixed uint32-value-plus-id
+// packet, or a framed wire.Record packet carrying one or more records.
+func (l *UDPListener) Listen(output func(wire.Record)) {
+	// Read incoming messages in a loop, allocate the buf only once. Sized for
+	// the largest framed packet we're willing to accept.
+	buf := make([]byte, 65536)
 
 	for {
 		select {
 		case <-l.quit:
 			_ = l.conn.Close()
-			break
+			return
 		default:
 			n, _, err := l.conn.ReadFromUDP(buf)
-			if n != 5 {
-				println("Should be 5 bytes, ignoring not: ", n)
+			if err != nil {
 				continue
 			}
-			if err != nil {
-				panic(err)
+			switch {
+			case n == wire.LegacyPacketSize:
+				value := binary.LittleEndian.Uint32(buf[0:4])
+				output(wire.Record{ID: buf[4], ValueUs: value})
+			case n >= 4 && binary.LittleEndian.Uint32(buf[0:4]) == wire.Magic:
+				records, err := wire.DecodeFrame(buf[:n])
+				if err != nil {
+					println("bad frame, ignoring: ", err.Error())
+					continue
+				}
+				for _, r := range records {
+					output(r)
+				}
+			default:
+				println("Unrecognized packet of ", n, " bytes, ignoring")
 			}
-			value := binary.LittleEndian.Uint32(buf[0:4])
-			output(value, buf[4])
 		}
 	}
 }
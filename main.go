@@ -1,15 +1,56 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"time"
 )
 
+var (
+	listDevices = flag.Bool("list-devices", false, "list available audio devices (input and output) and exit")
+	device      = flag.String("device", "", "output device name (substring) or index to use; defaults to the system default")
+	sinkName    = flag.String("sink", "audio", "sink to play percentiles through: audio or midi")
+	midiDevice  = flag.String("midi-device", "", "midi output device name (substring) or index to use; defaults to the system default")
+	httpAddr    = flag.String("http", "", "address to serve /metrics, /api/config and the live dashboard on (e.g. :8080); disabled if empty")
+)
+
 func main() {
-	// Create the audio streamer and the udp listener.
-	s, err := CreateStreamer()
+	flag.Parse()
+
+	if *listDevices {
+		devices, err := ListDevices()
+		if err != nil {
+			fmt.Printf("Failed to list devices %v", err)
+			os.Exit(2)
+		}
+		for _, d := range devices {
+			fmt.Printf("%d: %s (in: %d, out: %d, rate: %.0f, latency in/out: %v/%v)\n",
+				d.Index, d.Name, d.MaxInputChannels, d.MaxOutputChannels, d.DefaultSampleRate,
+				d.DefaultLowInputLatency, d.DefaultLowOutputLatency)
+		}
+		return
+	}
+
+	// Create the sink that will render percentiles, then the streamer and
+	// the udp listener that feed it.
+	var sink Sink
+	var err error
+	switch *sinkName {
+	case "midi":
+		sink, err = newMidiSink(*midiDevice)
+	case "audio":
+		sink, err = newAudioSink(*device)
+	default:
+		err = fmt.Errorf("unknown sink %q, want audio or midi", *sinkName)
+	}
+	if err != nil {
+		fmt.Printf("Failed to initialize sink %v", err)
+		os.Exit(2)
+	}
+
+	s, err := CreateStreamer(sink)
 	if err != nil {
 		fmt.Printf("Failed to initialize audio %v", err)
 		os.Exit(2)
@@ -24,8 +65,21 @@ func main() {
 	go l.Listen(s.Record)
 	// Play the audio.
 	go s.StartPlaying()
-	// Record as well.
-	go s.StartRecording(fmt.Sprintf("/tmp/recording-%v.wav", time.Now().Format(time.RFC3339)))
+	// Record as well, if we're playing through the audio sink.
+	if audio, ok := sink.(*audioSink); ok {
+		go audio.StartRecording(fmt.Sprintf("/tmp/recording-%v.wav", time.Now().Format(time.RFC3339)))
+	}
+
+	// Serve the control/observability plane, if requested.
+	var http *httpServer
+	if *httpAddr != "" {
+		http, err = newHTTPServer(*httpAddr, s)
+		if err != nil {
+			fmt.Printf("Failed to initialize http server %v", err)
+			os.Exit(2)
+		}
+		http.Start()
+	}
 
 	// Close things cleanly on Ctrl-C. portaudio terminate needs to be called on
 	// shutdown.
@@ -35,4 +89,7 @@ func main() {
 	fmt.Println("Stopping program")
 	s.Stop()
 	l.Stop()
+	if http != nil {
+		http.Stop()
+	}
 }
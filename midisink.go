@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/rakyll/portmidi"
+)
+
+// midiSink maps each Voice onto a chord on its own MIDI channel (id%16) of an
+// external synth or DAW, instead of synthesizing raw sines: baseStep becomes
+// the root note and the 8 harmonic multipliers become notes in a chord, with
+// the same amplitude ratios audioSink uses driving velocity, and Voice.Pan
+// driving the channel's pan controller. Much more musically useful for
+// long-running monitoring than raw sines.
+type midiSink struct {
+	deviceID portmidi.DeviceID
+	stream   *portmidi.Stream
+
+	// active[id] is the set of MIDI notes currently sounding for that
+	// Voice's channel, so Play knows which ones to turn off when its chord
+	// changes or the voice disappears.
+	active map[byte]map[int64]bool
+}
+
+// newMidiSink creates a Sink that plays through device, selected by name
+// (substring match) or index; an empty string uses the portmidi default
+// output device.
+func newMidiSink(device string) (*midiSink, error) {
+	if err := portmidi.Initialize(); err != nil {
+		return nil, err
+	}
+	id, err := findMidiDevice(device)
+	if err != nil {
+		return nil, err
+	}
+	return &midiSink{deviceID: id, active: make(map[byte]map[int64]bool)}, nil
+}
+
+// findMidiDevice resolves spec (an empty string, a device index, or a
+// case-insensitive substring of a device name) to an output-capable MIDI
+// device. An empty spec returns the portmidi default output device.
+func findMidiDevice(spec string) (portmidi.DeviceID, error) {
+	if spec == "" {
+		id := portmidi.DefaultOutputDeviceID()
+		if id < 0 {
+			return 0, fmt.Errorf("no default midi output device")
+		}
+		return id, nil
+	}
+	if idx, err := strconv.Atoi(spec); err == nil {
+		id := portmidi.DeviceID(idx)
+		if info := portmidi.Info(id); info == nil || !info.IsOutputAvailable {
+			return 0, fmt.Errorf("no midi output device with index %d", idx)
+		}
+		return id, nil
+	}
+	lower := strings.ToLower(spec)
+	count := portmidi.CountDevices()
+	for id := portmidi.DeviceID(0); int(id) < count; id++ {
+		info := portmidi.Info(id)
+		if info.IsOutputAvailable && strings.Contains(strings.ToLower(info.Name), lower) {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("no midi output device matching %q", spec)
+}
+
+// Start opens the MIDI output stream.
+func (m *midiSink) Start() error {
+	stream, err := portmidi.NewOutputStream(m.deviceID, 1024, 0)
+	if err != nil {
+		return err
+	}
+	m.stream = stream
+	return nil
+}
+
+// rootNote converts baseStep (cycles/sample, as computed by
+// convertLatencyToStep) into a MIDI note number, the same way render turns
+// it into a base frequency.
+func rootNote(baseStep float64) int64 {
+	freq := baseStep * rate
+	note := 69 + 12*math.Log2(freq/440.0) // A4 = note 69 = 440Hz
+	return int64(math.Round(math.Max(0, math.Min(127, note))))
+}
+
+// Play maps each Voice onto a chord on its own channel: baseStep is the
+// root, each harmonic multiplier becomes a note offset in semitones, and the
+// amplitude ratio between adjacent percentiles becomes velocity. Voice.Pan
+// is sent as the channel's pan controller (CC10). Notes no longer present
+// get a NoteOff, and channels for voices that disappeared are silenced.
+func (m *midiSink) Play(voices []Voice) {
+	ampClamp := getAmpClamp()
+	seen := make(map[byte]bool, len(voices))
+	for _, v := range voices {
+		seen[v.ID] = true
+		channel := int64(v.ID % 16)
+
+		baseStep := convertLatencyToStep(v.Percentiles[0])
+		root := rootNote(baseStep)
+
+		next := make(map[int64]bool, len(multipliers))
+		prevP := 0.0
+		for i, p := range v.Percentiles {
+			ratio := math.Min(float64(p)/prevP, ampClamp) - 1
+			prevP = float64(p)
+			if ratio <= 0 {
+				continue
+			}
+			note := root + int64(math.Round(12*math.Log2(multipliers[i])))
+			if note < 0 || note > 127 {
+				continue
+			}
+			if !m.active[v.ID][note] {
+				velocity := int64(math.Min(127, ratio*127/2))
+				_ = m.stream.WriteShort(0x90|channel, note, velocity) // Note On
+			}
+			next[note] = true
+		}
+
+		pan := int64((v.Pan + 1) / 2 * 127)
+		_ = m.stream.WriteShort(0xB0|channel, 10, pan) // CC10 = pan
+
+		for note := range m.active[v.ID] {
+			if !next[note] {
+				_ = m.stream.WriteShort(0x80|channel, note, 0) // Note Off
+			}
+		}
+		m.active[v.ID] = next
+	}
+
+	// A voice that's stopped sending data no longer shows up above; silence
+	// whatever it left sounding.
+	for id, notes := range m.active {
+		if seen[id] {
+			continue
+		}
+		channel := int64(id % 16)
+		for note := range notes {
+			_ = m.stream.WriteShort(0x80|channel, note, 0)
+		}
+		delete(m.active, id)
+	}
+}
+
+// Stop silences any still-sounding notes and closes the stream.
+func (m *midiSink) Stop() {
+	for id, notes := range m.active {
+		channel := int64(id % 16)
+		for note := range notes {
+			_ = m.stream.WriteShort(0x80|channel, note, 0)
+		}
+	}
+	_ = m.stream.Close()
+	_ = portmidi.Terminate()
+}
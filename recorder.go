@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// RecordFormat selects the sample encoding StartRecording writes to disk.
+type RecordFormat int
+
+const (
+	// Int16Format writes classic 16-bit PCM samples.
+	Int16Format RecordFormat = iota
+	// Float32Format writes IEEE float32 samples, avoiding the quantization
+	// of Int16Format at the cost of a larger file.
+	Float32Format
+)
+
+// recordRingSize gives the draining goroutine 4 buffers worth of slack to
+// catch up with the audio callback without the callback ever blocking on
+// disk I/O. render's tap writes a stereo-interleaved buffer (2*fftN floats
+// per callback), so the ring needs to scale by wavChannels too, or the real
+// slack is only half what's documented here.
+const recordRingSize = 4 * fftN * wavChannels
+
+// recorder is the tap installed inside audioSink.render: the audio callback
+// copies samples into ring and publishes writeIdx, and drain (running on its
+// own goroutine) consumes them and streams a WAV file. Sizes are fixed so
+// the callback side never allocates.
+type recorder struct {
+	ring     [recordRingSize]float32
+	writeIdx uint64 // total samples written so far; slot is writeIdx % len(ring)
+	readIdx  uint64 // total samples drained so far, owned by drain
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+// write copies samples into the ring and publishes the new writeIdx. This is
+// called from the portaudio callback and must never block.
+func (r *recorder) write(samples []float32) {
+	idx := r.writeIdx
+	for _, v := range samples {
+		r.ring[idx%recordRingSize] = v
+		idx++
+	}
+	// Publish the index only after the samples are in place so drain never
+	// reads a half-written slot.
+	atomic.StoreUint64(&r.writeIdx, idx)
+}
+
+// drain runs on a background goroutine, converting ring samples into w's
+// format and writing them out until quit is closed, at which point it
+// flushes whatever remains, patches the header, and closes done.
+func (r *recorder) drain(w *wavWriter) {
+	defer close(r.done)
+	for {
+		write := atomic.LoadUint64(&r.writeIdx)
+		n := write - r.readIdx
+		if n == 0 {
+			select {
+			case <-r.quit:
+				_ = w.Close()
+				return
+			case <-time.After(5 * time.Millisecond):
+				continue
+			}
+		}
+		if n > recordRingSize {
+			// The callback lapped us; the oldest unread samples are gone.
+			fmt.Printf("recording: fell behind, dropped %d samples\n", n-recordRingSize)
+			r.readIdx = write - recordRingSize
+			n = recordRingSize
+		}
+		for i := uint64(0); i < n; i++ {
+			w.writeSample(r.ring[(r.readIdx+i)%recordRingSize])
+		}
+		r.readIdx += n
+	}
+}
+
+// wavWriter streams a RIFF/WAVE file one sample at a time, patching the
+// chunk sizes in the header once the total length is known.
+type wavWriter struct {
+	f      *os.File
+	format RecordFormat
+	nBytes uint32
+}
+
+const wavSampleRate = rate
+
+// wavChannels is 2 because audioSink.render mixes every voice down to a
+// stereo buffer before the recorder tap ever sees it.
+const wavChannels = 2
+
+// createWavWriter opens path and writes a placeholder WAV header (patched on
+// Close once the data size is known).
+func createWavWriter(path string, format RecordFormat) (*wavWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &wavWriter{f: f, format: format}
+	if err := w.writeHeader(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *wavWriter) bitsPerSample() uint16 {
+	if w.format == Float32Format {
+		return 32
+	}
+	return 16
+}
+
+func (w *wavWriter) audioFormat() uint16 {
+	if w.format == Float32Format {
+		return 3 // WAVE_FORMAT_IEEE_FLOAT
+	}
+	return 1 // WAVE_FORMAT_PCM
+}
+
+func (w *wavWriter) writeHeader() error {
+	blockAlign := wavChannels * w.bitsPerSample() / 8
+	byteRate := wavSampleRate * uint32(blockAlign)
+
+	header := struct {
+		RIFFID        [4]byte
+		ChunkSize     uint32
+		WAVEID        [4]byte
+		FmtID         [4]byte
+		FmtSize       uint32
+		AudioFormat   uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		DataID        [4]byte
+		DataSize      uint32
+	}{
+		RIFFID:        [4]byte{'R', 'I', 'F', 'F'},
+		WAVEID:        [4]byte{'W', 'A', 'V', 'E'},
+		FmtID:         [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		AudioFormat:   w.audioFormat(),
+		Channels:      wavChannels,
+		SampleRate:    wavSampleRate,
+		ByteRate:      byteRate,
+		BlockAlign:    blockAlign,
+		BitsPerSample: w.bitsPerSample(),
+		DataID:        [4]byte{'d', 'a', 't', 'a'},
+	}
+	return binary.Write(w.f, binary.LittleEndian, &header)
+}
+
+// writeSample appends one sample, encoded per w.format.
+func (w *wavWriter) writeSample(v float32) {
+	if w.format == Float32Format {
+		_ = binary.Write(w.f, binary.LittleEndian, v)
+		w.nBytes += 4
+		return
+	}
+	clamped := math.Max(-1, math.Min(1, float64(v)))
+	_ = binary.Write(w.f, binary.LittleEndian, int16(clamped*32767))
+	w.nBytes += 2
+}
+
+// Close patches the RIFF and data chunk sizes now that the total size is
+// known, then closes the file.
+func (w *wavWriter) Close() error {
+	if _, err := w.f.Seek(4, 0); err != nil {
+		return err
+	}
+	if err := binary.Write(w.f, binary.LittleEndian, uint32(36+w.nBytes)); err != nil {
+		return err
+	}
+	if _, err := w.f.Seek(40, 0); err != nil {
+		return err
+	}
+	if err := binary.Write(w.f, binary.LittleEndian, w.nBytes); err != nil {
+		return err
+	}
+	return w.f.Close()
+}
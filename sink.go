@@ -0,0 +1,20 @@
+package main
+
+// Voice is one source ID's percentile snapshot plus where to place it in the
+// stereo field, handed to a Sink on every tick.
+type Voice struct {
+	ID          byte
+	Pan         float64 // -1 (left) .. 1 (right)
+	Percentiles [8]uint32
+}
+
+// Sink renders the current set of Voices, one per source ID. Exactly one
+// Sink is active per run, chosen with --sink in main.go.
+type Sink interface {
+	// Start opens whatever device this Sink drives.
+	Start() error
+	// Play is called with a fresh set of Voices roughly every tickInterval.
+	Play(voices []Voice)
+	// Stop releases the device.
+	Stop()
+}
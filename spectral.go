@@ -0,0 +1,125 @@
+package main
+
+import "math"
+
+// fftN is the length of the spectral synthesis buffer. It must match the
+// FramesPerBuffer used when opening the portaudio stream (see
+// audioSink.Start) and must be a power of two.
+const fftN = 1024
+
+// fftBits is log2(fftN).
+const fftBits = 10
+
+// spectralSynth turns a handful of harmonic (frequency, amplitude) pairs into
+// a real-valued time-domain buffer via an inverse FFT, replacing the old
+// per-sample sum of math.Sin calls. All buffers are fixed-size and
+// preallocated so audioSink.render allocates nothing per buffer for a voice
+// it has already seen.
+type spectralSynth struct {
+	bitRev  [fftN]int
+	twiddle [fftN / 2]complex128
+	freq    [fftN]complex128
+
+	// phase carries the exact phase (in turns, 0..1) of each harmonic
+	// between calls so the tone stays phase-continuous across buffers even
+	// though deposit restricts it to the FFT's discrete bins.
+	phase [8]float64
+}
+
+// newSpectralSynth precomputes the bit-reversal table and twiddle factors
+// used by ifft. audioSink.render calls it once per source ID, the first
+// time that ID's voice is rendered.
+func newSpectralSynth() *spectralSynth {
+	sp := &spectralSynth{}
+	for i := range sp.bitRev {
+		sp.bitRev[i] = bitReverse(i, fftBits)
+	}
+	for k := range sp.twiddle {
+		angle := 2 * math.Pi * float64(k) / float64(fftN)
+		sp.twiddle[k] = complex(math.Cos(angle), math.Sin(angle))
+	}
+	return sp
+}
+
+// bitReverse reverses the low bits bits of v.
+func bitReverse(v, bits int) int {
+	r := 0
+	for i := 0; i < bits; i++ {
+		r = (r << 1) | (v & 1)
+		v >>= 1
+	}
+	return r
+}
+
+// reset zeroes the frequency-domain buffer so it's ready for this buffer's
+// deposit calls.
+func (sp *spectralSynth) reset() {
+	for i := range sp.freq {
+		sp.freq[i] = 0
+	}
+}
+
+// deposit adds a harmonic at the given frequency step (in cycles/sample) and
+// amplitude into the frequency-domain buffer. The energy is split linearly
+// across the two nearest bins (rather than rounded to the closest one) to
+// avoid audible quantization as step drifts between bins.
+func (sp *spectralSynth) deposit(harmonic int, step, amp float64) {
+	bin := step * fftN
+	lo := int(math.Floor(bin))
+	frac := bin - float64(lo)
+	hi := lo + 1
+	if lo >= fftN {
+		lo = fftN - 1
+	}
+	if hi >= fftN {
+		hi = fftN - 1
+	}
+
+	// Rotate the deposited energy by this harmonic's carried phase so
+	// consecutive buffers line up instead of each one restarting at phase 0.
+	ph := sp.phase[harmonic]
+	re, im := math.Cos(2*math.Pi*ph), math.Sin(2*math.Pi*ph)
+	sp.freq[lo] += complex(amp*(1-frac)*re, amp*(1-frac)*im)
+	sp.freq[hi] += complex(amp*frac*re, amp*frac*im)
+
+	// Advance by exactly one buffer's worth of cycles at this frequency,
+	// wrapping back into 0..1 the same way the old per-sample phase did.
+	_, sp.phase[harmonic] = math.Modf(ph + bin)
+}
+
+// generate runs the in-place IFFT over freq and writes its real part into
+// out, which must have length fftN. Each deposited harmonic occupies only
+// one or two bins out of fftN, so ifft's sum already comes out at the
+// deposited amplitude directly; no additional 1/N normalization is needed
+// (and applying one would attenuate every tone by a factor of fftN).
+func (sp *spectralSynth) generate(out []float32) {
+	sp.ifft()
+	for i, v := range sp.freq {
+		out[i] = float32(real(v))
+	}
+}
+
+// ifft performs an in-place inverse FFT of sp.freq using the precomputed
+// bit-reversal table and twiddle factors: bit-reversal permutation followed
+// by log2(fftN) butterfly stages. See generate for why no 1/N scaling is
+// applied.
+func (sp *spectralSynth) ifft() {
+	for i, j := range sp.bitRev {
+		if i < j {
+			sp.freq[i], sp.freq[j] = sp.freq[j], sp.freq[i]
+		}
+	}
+	for size := 2; size <= fftN; size <<= 1 {
+		half := size / 2
+		step := fftN / size
+		for start := 0; start < fftN; start += size {
+			for k := 0; k < half; k++ {
+				w := sp.twiddle[k*step]
+				t := w * sp.freq[start+k+half]
+				u := sp.freq[start+k]
+				sp.freq[start+k] = u + t
+				sp.freq[start+k+half] = u - t
+			}
+		}
+	}
+}
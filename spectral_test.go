@@ -0,0 +1,59 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBitReverse(t *testing.T) {
+	tests := []struct {
+		v, bits, want int
+	}{
+		{0, 4, 0},
+		{1, 4, 8},
+		{0b0001, 3, 0b100},
+		{0b0110, 4, 0b0110},
+	}
+	for _, tc := range tests {
+		if got := bitReverse(tc.v, tc.bits); got != tc.want {
+			t.Errorf("bitReverse(%b, %d) = %b, want %b", tc.v, tc.bits, got, tc.want)
+		}
+	}
+}
+
+// TestGenerateSingleBinIsACosine deposits a single harmonic exactly on a bin
+// (no fractional split) and checks generate against the closed-form inverse
+// DFT for a single nonzero bin, to guard the no-1/N-scaling invariant
+// documented on generate.
+func TestGenerateSingleBinIsACosine(t *testing.T) {
+	sp := newSpectralSynth()
+	sp.reset()
+
+	const k = 7 // arbitrary bin, falls exactly on an integer so frac == 0
+	sp.deposit(0, float64(k)/fftN, 1.0)
+
+	var out [fftN]float32
+	sp.generate(out[:])
+
+	for n := 0; n < fftN; n++ {
+		want := math.Cos(2 * math.Pi * float64(k) * float64(n) / fftN)
+		if got := float64(out[n]); math.Abs(got-want) > 1e-4 {
+			t.Fatalf("out[%d] = %v, want %v", n, got, want)
+		}
+	}
+}
+
+// TestDepositSplitsEnergyAcrossBins checks the linear-interpolation behavior
+// deposit documents for frequencies that fall between two bins.
+func TestDepositSplitsEnergyAcrossBins(t *testing.T) {
+	sp := newSpectralSynth()
+	sp.reset()
+	sp.deposit(0, 2.5/fftN, 1.0)
+
+	if real(sp.freq[2]) == 0 || real(sp.freq[3]) == 0 {
+		t.Fatalf("expected energy split across bins 2 and 3, got freq[2]=%v freq[3]=%v", sp.freq[2], sp.freq[3])
+	}
+	if sp.freq[4] != 0 {
+		t.Fatalf("expected no energy outside bins 2 and 3, got freq[4]=%v", sp.freq[4])
+	}
+}
@@ -1,12 +1,12 @@
 package main
 
 import (
-	"fmt"
 	"math"
-	"math/rand"
 	"sort"
+	"sync"
+	"time"
 
-	"github.com/gordonklaus/portaudio"
+	"github.com/andrewbaptist/latency/wire"
 )
 
 // This is a high quality audio quality.
@@ -15,26 +15,51 @@ const rate = 44100
 // Choose "harmonic notes"
 var multipliers = []float64{1.0, 5.0 / 4, 4.0 / 3, 3.0 / 2, 5.0 / 3, 2.0, 5.0 / 2, 3.0}
 
-// Streamer stores the last 256 data points.
+// minFreqHz, maxFreqHz and ampClamp are the runtime-tunable knobs behind
+// convertLatencyToStep and the per-harmonic amplitude clamp in render and
+// midiSink.Play. They default to the values this tool originally hardcoded,
+// and can be changed at runtime via the /api/config endpoint (see
+// httpserver.go).
+var (
+	minFreqHz = 100.0
+	maxFreqHz = 400.0
+	ampClamp  = 3.0
+)
+
+// tuneMu guards minFreqHz, maxFreqHz and ampClamp. Unlike the documented
+// single-writer races elsewhere in this file (e.g. percentileRing.data),
+// SetConfig is a genuine concurrent writer invoked from whatever goroutine
+// handles an /api/config request, racing against convertLatencyToStep,
+// audioSink.render and midiSink.Play on the playback side, so these need
+// real synchronization rather than a shrug.
+var tuneMu sync.RWMutex
+
+// percentileRing stores the last 256 data points for a single source ID and
+// computes the 8 percentiles a Sink turns into sound.
 // This code intentionally avoids as much heap allocation as possible by
 // statically defining all sizes. GCs can cause blips in the audio.
-type Streamer struct {
-	// Store the last 256 points.
+type percentileRing struct {
 	data        [256]uint32
 	dataCounter byte
 	totalPoints int64
-	counter     int
-	// phase is the "x-axis" of the sine curve.
-	phase      [8]float64
-	includeIds []byte
-	quit       chan struct{}
+}
+
+// record is not thread-safe; the caller must ensure it isn't called
+// concurrently for the same ring.
+func (r *percentileRing) record(value uint32) {
+	// This is a data race with the reader, but we don't care since we are
+	// the single writer, and we are writing single values.
+	r.data[r.dataCounter] = value
+	// This will auto-wrap at 256 which is why we chose byte type.
+	r.dataCounter += 1
+	r.totalPoints += 1
 }
 
 // Chose 8 steps along the way from smallest to biggest.
-func (s *Streamer) getPercentiles() [8]uint32 {
+func (r *percentileRing) getPercentiles() [8]uint32 {
 	// Copy all the values over since we don't want to sort the underlying
 	// array. This is "racy" with writes, but we don't want locking.
-	d := s.data
+	d := r.data
 
 	sort.Slice(d[:], func(i, j int) bool { return d[i] > d[j] })
 	var steps [8]uint32
@@ -56,121 +81,205 @@ func (s *Streamer) getPercentiles() [8]uint32 {
 // 1ms -> 23Hz
 // 100ms -> 69Hz
 func convertLatencyToStep(micro uint32) float64 {
+	tuneMu.RLock()
+	min, max := minFreqHz, maxFreqHz
+	tuneMu.RUnlock()
 	rawStep := 30 * math.Log1p(math.Max(float64(micro), 1))
-	normal := math.Min(math.Max(rawStep, 100.0), 400.0)
+	normal := math.Min(math.Max(rawStep, min), max)
 	// Normalize based on the sound base rate.
 	return normal / rate
 }
 
-// This is called repeatedly with a "small window" of time. We need to fill
-// "rate" steps per second. so if step is 1.0, we will have a 1Hz sine wave.
-func (s *Streamer) genAudio(out []float32) {
-	percentiles := s.getPercentiles()
+// getAmpClamp returns the current per-harmonic amplitude clamp under tuneMu;
+// audioSink.render and midiSink.Play call this instead of reading ampClamp
+// directly so they never race with SetConfig.
+func getAmpClamp() float64 {
+	tuneMu.RLock()
+	defer tuneMu.RUnlock()
+	return ampClamp
+}
+
+// Streamer fans incoming records out to one percentileRing per source ID and
+// feeds a Sink the resulting set of Voices every tick, so each ID sounds
+// like an independent voice in the mix instead of being blended into one
+// global percentile ring.
+type Streamer struct {
+	mu     sync.Mutex
+	shards map[byte]*percentileRing
+	// order records shard creation order; a voice's position in it decides
+	// where Sink pans it.
+	order      []byte
+	includeIds []byte
+	// lastVoices caches the most recent snapshot fed to the sink so the
+	// HTTP plane (see httpserver.go) can read it without recomputing
+	// percentiles.
+	lastVoices []Voice
+
+	quit chan struct{}
+	sink Sink
+}
+
+// Config holds the runtime-tunable knobs exposed over /api/config: which
+// source IDs contribute to the mix, the frequency range
+// convertLatencyToStep maps into, and the per-harmonic amplitude clamp.
+// Zero-valued fields in a SetConfig call are left unchanged.
+type Config struct {
+	IncludeIds []byte  `json:"includeIds"`
+	MinFreqHz  float64 `json:"minFreqHz"`
+	MaxFreqHz  float64 `json:"maxFreqHz"`
+	AmpClamp   float64 `json:"ampClamp"`
+}
+
+// GetConfig returns the current tunables.
+func (s *Streamer) GetConfig() Config {
+	s.mu.Lock()
+	ids := append([]byte(nil), s.includeIds...)
+	s.mu.Unlock()
+	tuneMu.RLock()
+	defer tuneMu.RUnlock()
+	return Config{IncludeIds: ids, MinFreqHz: minFreqHz, MaxFreqHz: maxFreqHz, AmpClamp: ampClamp}
+}
 
-	// Reset all the values since the same array is reused each time.
-	for i := range out {
-		out[i] = 0
+// SetConfig updates whichever tunables are set in cfg; a nil IncludeIds or a
+// zero-valued float leaves that knob unchanged.
+func (s *Streamer) SetConfig(cfg Config) {
+	if cfg.IncludeIds != nil {
+		s.mu.Lock()
+		s.includeIds = cfg.IncludeIds
+		s.mu.Unlock()
 	}
+	tuneMu.Lock()
+	if cfg.MinFreqHz != 0 {
+		minFreqHz = cfg.MinFreqHz
+	}
+	if cfg.MaxFreqHz != 0 {
+		maxFreqHz = cfg.MaxFreqHz
+	}
+	if cfg.AmpClamp != 0 {
+		ampClamp = cfg.AmpClamp
+	}
+	tuneMu.Unlock()
+}
 
-	baseStep := convertLatencyToStep(percentiles[0])
-	prevP := 0.0
-
-	// fill with a superposition of the waves
-	// Add all the frequencies together (see fourier transform).
-	// Compute the next several steps of the sine waves based on the step and amp.
-	for i, p := range percentiles {
-		// We want all waves to have the same "period" which is computed by the P50 value.
-		// step is a multiple of the base rate, each step is half the previous step.
-		// higher P values have higher frequency steps.
-		step := baseStep * multipliers[i]
-
-		// amp is the height of the sine curve which is based on ratio from
-		// adjacent step. Start with amp 1 for the base, and increase for the
-		// others. Don't allow any individual amp to get above 2.0 (your ears
-		// will thank me).
-		amp := math.Min(float64(p)/prevP, 3.0) - 1
-		prevP = float64(p)
-
-		// Periodically print this. Could change to time based instead.
-		if s.counter%1000 == 0 {
-			fmt.Printf("%d: %0.2f %d\n", i, amp, p)
-		}
+// Voices returns the most recent snapshot handed to the sink.
+func (s *Streamer) Voices() []Voice {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastVoices
+}
 
-		for j := range out {
-			// get the next output value for this curve and add to the others.
-			nextOut := amp * math.Sin(2*math.Pi*s.phase[i])
-			out[j] += float32(nextOut)
-			// move phase along in small steps update for next time, resetting
-			// to 0 so that we can avoid wild swings when we change the step size.
-			// Phase always stays between 0 and 1.
-			_, s.phase[i] = math.Modf(s.phase[i] + step)
-		}
+// TotalPoints returns the total number of records received for id.
+func (s *Streamer) TotalPoints(id byte) int64 {
+	s.mu.Lock()
+	shard := s.shards[id]
+	s.mu.Unlock()
+	if shard == nil {
+		return 0
 	}
-	if s.counter%1000 == 0 {
-		fmt.Println("Base freq: ", int(baseStep*rate))
+	return shard.totalPoints
+}
+
+// CreateStreamer creates a new Streamer that will feed sink a Voice per
+// source ID seen by Record.
+func CreateStreamer(sink Sink) (*Streamer, error) {
+	return &Streamer{
+		shards: make(map[byte]*percentileRing),
+		quit:   make(chan struct{}),
+		sink:   sink,
+	}, nil
+}
+
+// Record is not thread-safe against concurrent calls; the caller
+// (UDPListener.Listen) only ever calls it from one goroutine.
+func (s *Streamer) Record(rec wire.Record) {
+	s.mu.Lock()
+	includeIds := s.includeIds
+	s.mu.Unlock()
+	if len(includeIds) > 0 && !byteIn(includeIds, rec.ID) {
+		return
 	}
-	s.counter++
-}
-
-// Record is not thread-safe. The caller of this method should ensure it is
-// not called concurrently.
-func (s *Streamer) Record(value uint32, id byte) {
-	if len(s.includeIds) > 0 {
-		found := false
-		for _, include := range s.includeIds {
-			if id == include {
-				found = true
-				break
-			}
-		}
-		if !found {
-			return
-		}
 
+	s.mu.Lock()
+	shard, ok := s.shards[rec.ID]
+	if !ok {
+		shard = &percentileRing{}
+		s.shards[rec.ID] = shard
+		s.order = append(s.order, rec.ID)
 	}
-	// This is a data race with the reader, but we don't care  since we are the
-	// single writer, and we are writing single values.
-	s.data[s.dataCounter] = value
-	// This will auto-wrap at 256 which is why we chose byte type.
-	s.dataCounter += 1
-	s.totalPoints += 1
+	s.mu.Unlock()
+
+	shard.record(rec.ValueUs)
+}
+
+// byteIn reports whether v is present in ids.
+func byteIn(ids []byte, v byte) bool {
+	for _, id := range ids {
+		if id == v {
+			return true
+		}
+	}
+	return false
 }
 
-// CreateStreamer creates a new streamer.
-func CreateStreamer() (*Streamer, error) {
-	err := portaudio.Initialize()
-	if err != nil {
-		return nil, err
+// voices snapshots the current percentiles of every shard allowed by
+// includeIds, panned evenly across the stereo field in shard creation order.
+func (s *Streamer) voices() []Voice {
+	s.mu.Lock()
+	ids := make([]byte, 0, len(s.order))
+	for _, id := range s.order {
+		if len(s.includeIds) == 0 || byteIn(s.includeIds, id) {
+			ids = append(ids, id)
+		}
 	}
-	s := Streamer{quit: make(chan struct{})}
-	// Fill some random data, with a normal distribution.
-	for i := range s.data {
-		s.data[i] = uint32(math.Max(rand.NormFloat64()*10000+10000, 0))
+	s.mu.Unlock()
+
+	if len(ids) == 0 {
+		return nil
 	}
-	for i := range &s.phase {
-		s.phase[i] = 0.0
+	voices := make([]Voice, len(ids))
+	for i, id := range ids {
+		s.mu.Lock()
+		shard := s.shards[id]
+		s.mu.Unlock()
+
+		pan := 0.0
+		if len(ids) > 1 {
+			pan = -1 + 2*float64(i)/float64(len(ids)-1)
+		}
+		voices[i] = Voice{ID: id, Pan: pan, Percentiles: shard.getPercentiles()}
 	}
-	return &s, nil
+	return voices
 }
 
-// StartPlaying will play audio with a tone based on the values passed into
-// Record.
+// tickInterval matches the duration of one audioSink buffer so the audio and
+// midi sinks see voice updates at the same cadence.
+const tickInterval = time.Second * fftN / rate
+
+// StartPlaying starts the configured sink and then feeds it a fresh set of
+// Voices every tickInterval until Stop is called.
 func (s *Streamer) StartPlaying() {
-	stream, err := portaudio.OpenDefaultStream(0, 1, rate, 1024, s.genAudio)
-	if err != nil {
-		panic(err)
-	}
-	err = stream.Start()
-	if err != nil {
+	if err := s.sink.Start(); err != nil {
 		panic(err)
 	}
 
-	// Run until Stop is called.
-	<-s.quit
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+			voices := s.voices()
+			s.mu.Lock()
+			s.lastVoices = voices
+			s.mu.Unlock()
+			s.sink.Play(voices)
+		}
+	}
 }
 
-// Stop the portaudio device.
+// Stop the sink and the voice feed.
 func (s *Streamer) Stop() {
-	_ = portaudio.Terminate()
+	s.sink.Stop()
 	close(s.quit)
 }
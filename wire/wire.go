@@ -0,0 +1,97 @@
+// Package wire defines the UDP wire format the latency tool listens for, and
+// is shared by the listener and the client package so they can't drift apart.
+package wire
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Magic identifies a framed multi-record packet. UDPListener also still
+// accepts the original fixed-size LegacyPacketSize packet with no magic.
+const Magic uint32 = 0x4c41544e // "LATN"
+
+// Version is the only framed protocol version understood so far.
+const Version = 1
+
+// LegacyPacketSize is the wire size of the original uint32-value-plus-id-byte
+// packet.
+const LegacyPacketSize = 5
+
+// Record is one data point carried by the framed protocol.
+type Record struct {
+	ID          byte
+	TimestampUs uint64
+	ValueUs     uint32
+	Label       string
+}
+
+// frameHeaderSize is magic(4) + version(1) + count(2).
+const frameHeaderSize = 7
+
+// recordHeaderSize is id(1) + timestamp_us(8) + value_us(4) + label_len(1).
+const recordHeaderSize = 14
+
+// EncodeFrame encodes records as: magic, version, record count, then each
+// record as id, timestamp_us, value_us, label_len, label.
+func EncodeFrame(records []Record) ([]byte, error) {
+	if len(records) > 0xffff {
+		return nil, fmt.Errorf("too many records in one frame: %d", len(records))
+	}
+	buf := make([]byte, frameHeaderSize, frameHeaderSize+len(records)*recordHeaderSize)
+	binary.LittleEndian.PutUint32(buf[0:4], Magic)
+	buf[4] = Version
+	binary.LittleEndian.PutUint16(buf[5:7], uint16(len(records)))
+
+	var tmp [8]byte
+	for _, r := range records {
+		if len(r.Label) > 0xff {
+			return nil, fmt.Errorf("label too long: %d bytes", len(r.Label))
+		}
+		buf = append(buf, r.ID)
+		binary.LittleEndian.PutUint64(tmp[:8], r.TimestampUs)
+		buf = append(buf, tmp[:8]...)
+		binary.LittleEndian.PutUint32(tmp[:4], r.ValueUs)
+		buf = append(buf, tmp[:4]...)
+		buf = append(buf, byte(len(r.Label)))
+		buf = append(buf, r.Label...)
+	}
+	return buf, nil
+}
+
+// DecodeFrame parses a framed packet produced by EncodeFrame. buf must be
+// exactly one datagram; DecodeFrame does not handle partial frames.
+func DecodeFrame(buf []byte) ([]Record, error) {
+	if len(buf) < frameHeaderSize {
+		return nil, fmt.Errorf("frame too short: %d bytes", len(buf))
+	}
+	if binary.LittleEndian.Uint32(buf[0:4]) != Magic {
+		return nil, fmt.Errorf("bad magic")
+	}
+	if version := buf[4]; version != Version {
+		return nil, fmt.Errorf("unsupported protocol version %d", version)
+	}
+	count := binary.LittleEndian.Uint16(buf[5:7])
+
+	records := make([]Record, 0, count)
+	pos := frameHeaderSize
+	for i := 0; i < int(count); i++ {
+		if pos+recordHeaderSize > len(buf) {
+			return nil, fmt.Errorf("truncated record %d", i)
+		}
+		id := buf[pos]
+		ts := binary.LittleEndian.Uint64(buf[pos+1 : pos+9])
+		value := binary.LittleEndian.Uint32(buf[pos+9 : pos+13])
+		labelLen := int(buf[pos+13])
+		pos += recordHeaderSize
+
+		if pos+labelLen > len(buf) {
+			return nil, fmt.Errorf("truncated record %d", i)
+		}
+		label := string(buf[pos : pos+labelLen])
+		pos += labelLen
+
+		records = append(records, Record{ID: id, TimestampUs: ts, ValueUs: value, Label: label})
+	}
+	return records, nil
+}
@@ -0,0 +1,77 @@
+package wire
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEncodeDecodeFrameRoundTrip(t *testing.T) {
+	records := []Record{
+		{ID: 1, TimestampUs: 1000, ValueUs: 42, Label: "a"},
+		{ID: 2, TimestampUs: 2000, ValueUs: 84, Label: ""},
+		{ID: 3, TimestampUs: 3000, ValueUs: 126, Label: "longer label"},
+	}
+
+	buf, err := EncodeFrame(records)
+	if err != nil {
+		t.Fatalf("EncodeFrame: %v", err)
+	}
+	got, err := DecodeFrame(buf)
+	if err != nil {
+		t.Fatalf("DecodeFrame: %v", err)
+	}
+	if !reflect.DeepEqual(got, records) {
+		t.Fatalf("round trip mismatch: got %+v, want %+v", got, records)
+	}
+}
+
+func TestEncodeDecodeFrameEmpty(t *testing.T) {
+	buf, err := EncodeFrame(nil)
+	if err != nil {
+		t.Fatalf("EncodeFrame: %v", err)
+	}
+	got, err := DecodeFrame(buf)
+	if err != nil {
+		t.Fatalf("DecodeFrame: %v", err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("got %d records, want 0", len(got))
+	}
+}
+
+func TestEncodeFrameLabelTooLong(t *testing.T) {
+	if _, err := EncodeFrame([]Record{{Label: string(make([]byte, 256))}}); err == nil {
+		t.Fatal("EncodeFrame: want error for a 256-byte label, got nil")
+	}
+}
+
+func TestDecodeFrameErrors(t *testing.T) {
+	good, err := EncodeFrame([]Record{{ID: 1, TimestampUs: 1, ValueUs: 2, Label: "x"}})
+	if err != nil {
+		t.Fatalf("EncodeFrame: %v", err)
+	}
+
+	badMagic := append([]byte(nil), good...)
+	badMagic[0] ^= 0xff
+
+	badVersion := append([]byte(nil), good...)
+	badVersion[4] = Version + 1
+
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"too short for header", good[:frameHeaderSize-1]},
+		{"bad magic", badMagic},
+		{"bad version", badVersion},
+		{"truncated record header", good[:frameHeaderSize+1]},
+		{"truncated label", good[:len(good)-1]},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := DecodeFrame(tc.buf); err == nil {
+				t.Fatalf("DecodeFrame(%s): want error, got nil", tc.name)
+			}
+		})
+	}
+}